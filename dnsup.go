@@ -1,23 +1,27 @@
 package main
 
 import (
-	"context"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
-	"sync"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
-	"github.com/Azure/azure-sdk-for-go/profiles/latest/dns/mgmt/dns"
+	"github.com/DHowett/dnsup/providers"
 
-	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/azure/auth"
-	"github.com/Azure/go-autorest/autorest/to"
+	_ "github.com/DHowett/dnsup/providers/azure"
+	_ "github.com/DHowett/dnsup/providers/cloudflare"
+	_ "github.com/DHowett/dnsup/providers/gcp"
+	_ "github.com/DHowett/dnsup/providers/rfc2136"
+	_ "github.com/DHowett/dnsup/providers/route53"
 )
 
 func chooseUnicast(a []net.Addr) []*net.IPNet {
@@ -81,21 +85,53 @@ func (i *IP) ApplyIPToMask(ip net.IP) net.IP {
 	return newIp
 }
 
-type AzureConfig struct {
-	ClientID       string `yaml:"clientId"`
-	ClientSecret   string `yaml:"clientSecret"`
-	TenantID       string `yaml:"tenantId"`
-	SubscriptionID string `yaml:"subscriptionId"`
-	ResourceGroup  string `yaml:"resourceGroup"`
+func (i *IP) Is4() bool {
+	return i.ip.To4() != nil
+}
+
+// HostRecord is one entry of the `hosts:` map. Its shorthand form is a bare
+// CIDR string (e.g. `2001:db8::/64`), which resolves to an A or AAAA record
+// tracking the host's current address; its long form is a typed record
+// (`type: CNAME`, `TXT`, `MX`, or `SRV`) for values that don't come from a
+// local interface address.
+type HostRecord struct {
+	IP *IP
+
+	Type     string   `yaml:"type"`
+	Target   string   `yaml:"target"`
+	Values   []string `yaml:"values"`
+	Priority uint16   `yaml:"priority"`
+	Weight   uint16   `yaml:"weight"`
+	Port     uint16   `yaml:"port"`
+}
+
+func (h *HostRecord) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	ip := &IP{}
+	if err := ip.UnmarshalYAML(unmarshal); err == nil {
+		h.IP = ip
+		return nil
+	}
+
+	type plain HostRecord
+	return unmarshal((*plain)(h))
 }
 
+// Config is the top-level shape of dnsup's YAML config file. Provider
+// selects which registered backend (see package providers) publishes
+// records; that provider's own config lives in the section of the same
+// name (e.g. `azure:`, `cloudflare:`) and is handed to it unparsed.
 type Config struct {
-	AzureConfig AzureConfig `yaml:"azure"`
-	Zone        string      `yaml:"zone"`
-	Hosts       map[string]IP
-	Ttl         uint32 `yaml:"ttl"`
+	Provider string `yaml:"provider"`
+	Zone     string `yaml:"zone"`
+	Hosts    map[string]HostRecord
+	Ttl      uint32 `yaml:"ttl"`
+	Interval string `yaml:"interval"`
 }
 
+const defaultProvider = "azure"
+const defaultDaemonInterval = 5 * time.Minute
+const maxReconcileBackoff = 1 * time.Hour
+
 type DevNull struct{}
 
 func (dn *DevNull) Write(p []byte) (int, error) {
@@ -105,77 +141,169 @@ func (dn *DevNull) Close() error {
 	return nil
 }
 
-func (i *IP) Is4() bool {
-	return i.ip.To4() != nil
+// loadConfig reads and parses the YAML config file at path.
+func loadConfig(path string) (*Config, []byte, error) {
+	configData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(configData, config); err != nil {
+		return nil, nil, err
+	}
+	return config, configData, nil
 }
 
-/* Azure */
-type azureDnsUpdater struct {
-	logger        *log.Logger
-	dnsClient     dns.RecordSetsClient
-	resourceGroup string
-	zone          string
-	wg            sync.WaitGroup
-}
-
-func (a *azureDnsUpdater) SetARecord(host string, ip net.IP) {
-	a.wg.Add(1)
-	go func() {
-		_, err := a.dnsClient.CreateOrUpdate(context.Background(), a.resourceGroup, a.zone, host, "A", dns.RecordSet{
-			RecordSetProperties: &dns.RecordSetProperties{
-				TTL: to.Int64Ptr(300),
-				ARecords: &[]dns.ARecord{
-					dns.ARecord{
-						Ipv4Address: to.StringPtr(ip.String()),
-					},
-				},
-			},
-		}, "", "")
-		if err != nil {
-			a.logger.Print("Error updating ", host, ": ", err)
-		}
-		a.wg.Done()
-	}()
-}
-func (a *azureDnsUpdater) SetAAAARecord(host string, ip net.IP) {
-	a.wg.Add(1)
-	go func() {
-		_, err := a.dnsClient.CreateOrUpdate(context.Background(), a.resourceGroup, a.zone, host, "AAAA", dns.RecordSet{
-			RecordSetProperties: &dns.RecordSetProperties{
-				TTL: to.Int64Ptr(300),
-				AaaaRecords: &[]dns.AaaaRecord{
-					dns.AaaaRecord{
-						Ipv6Address: to.StringPtr(ip.String()),
-					},
-				},
-			},
-		}, "", "")
-		if err != nil {
-			a.logger.Print("Error updating ", host, ": ", err)
-		}
-		a.wg.Done()
-	}()
+// buildUpdater looks up the provider named by config.Provider (defaulting to
+// Azure) and constructs it from its own section of configData.
+func buildUpdater(logger *log.Logger, config *Config, configData []byte) (providers.DNSUpdater, error) {
+	providerName := config.Provider
+	if providerName == "" {
+		providerName = defaultProvider
+	}
+	factory, ok := providers.Get(providerName)
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q", providerName)
+	}
+
+	// Providers own their config sub-struct, so re-marshal just their
+	// section of the YAML document and let them parse it themselves. The
+	// top-level keys are a mix of scalars (zone, ttl, ...) and provider
+	// sections, so this has to decode into map[string]interface{} rather
+	// than map[string]yaml.MapSlice, which errors on the scalars.
+	var sections map[string]interface{}
+	if err := yaml.Unmarshal(configData, &sections); err != nil {
+		return nil, err
+	}
+	providerConfig, err := yaml.Marshal(sections[providerName])
+	if err != nil {
+		return nil, err
+	}
+
+	return factory(logger, config.Zone, config.Ttl, providerConfig)
 }
-func (a *azureDnsUpdater) Wait() {
-	a.wg.Wait()
+
+// recordKey returns a string uniquely identifying the value a HostRecord
+// would currently publish, so reconcile can detect when it hasn't changed
+// since the last successful pass. ok is false when the record can't be
+// resolved right now, e.g. an A/AAAA host whose source interface currently
+// has no address of that family (fourFrom/sixFrom down or reconfiguring).
+func recordKey(rec *HostRecord, four, sixPrefix net.IP) (key string, ok bool) {
+	if rec.IP != nil {
+		if rec.IP.Is4() {
+			if four == nil {
+				return "", false
+			}
+			return "A:" + rec.IP.ApplyIPToMask(four).String(), true
+		}
+		if sixPrefix == nil {
+			return "", false
+		}
+		return "AAAA:" + rec.IP.ApplyIPToMask(sixPrefix).String(), true
+	}
+
+	switch strings.ToUpper(rec.Type) {
+	case "CNAME":
+		return "CNAME:" + rec.Target, true
+	case "TXT":
+		return "TXT:" + strings.Join(rec.Values, "\x00"), true
+	case "MX":
+		return fmt.Sprintf("MX:%d:%s", rec.Priority, rec.Target), true
+	case "SRV":
+		return fmt.Sprintf("SRV:%d:%d:%d:%s", rec.Priority, rec.Weight, rec.Port, rec.Target), true
+	default:
+		return "UNKNOWN:" + rec.Type, true
+	}
 }
-func newAzureDnsUpdater(logger *log.Logger, authorizer autorest.Authorizer, subscription string, resourceGroup string, zone string) *azureDnsUpdater {
-	dnsClient := dns.NewRecordSetsClient(subscription)
-	dnsClient.Authorizer = authorizer
-	return &azureDnsUpdater{
-		logger:        logger,
-		dnsClient:     dnsClient,
-		resourceGroup: resourceGroup,
-		zone:          zone,
+
+// reconcile re-derives each host's current value (an address for the CIDR
+// shorthand, or the configured value for a typed record) and publishes only
+// the ones that changed since the last successful reconcile, as tracked in
+// last.
+func reconcile(logger *log.Logger, updater providers.DNSUpdater, config *Config, fourFrom, sixFrom string, last map[string]string) error {
+	var four, sixPrefix net.IP
+
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return fmt.Errorf("getting net interfaces: %w", err)
 	}
+	for _, iface := range ifs {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		if iface.Name == fourFrom {
+			four = chooseFour(chooseUnicast(addrs))
+		}
+		if iface.Name == sixFrom {
+			sixPrefix = chooseSix(chooseUnicast(addrs))
+		}
+	}
+
+	changed := map[string]string{}
+	for host, rec := range config.Hosts {
+		rec := rec
+		key, ok := recordKey(&rec, four, sixPrefix)
+		if !ok {
+			logger.Printf("Skipping %s, can't resolve its value this pass", host)
+			continue
+		}
+		if prev, ok := last[host]; ok && prev == key {
+			continue
+		}
+
+		if rec.IP != nil {
+			if rec.IP.Is4() {
+				finalIp := rec.IP.ApplyIPToMask(four)
+				logger.Printf("Updating %s to (IPv4) %v", host, finalIp)
+				updater.SetARecord(host, finalIp)
+			} else {
+				finalIp := rec.IP.ApplyIPToMask(sixPrefix)
+				logger.Printf("Updating %s to (IPv6) %v", host, finalIp)
+				updater.SetAAAARecord(host, finalIp)
+			}
+		} else {
+			switch strings.ToUpper(rec.Type) {
+			case "CNAME":
+				logger.Printf("Updating %s to (CNAME) %v", host, rec.Target)
+				updater.SetCNAMERecord(host, rec.Target)
+			case "TXT":
+				logger.Printf("Updating %s to (TXT) %v", host, rec.Values)
+				updater.SetTXTRecord(host, rec.Values)
+			case "MX":
+				logger.Printf("Updating %s to (MX) %d %v", host, rec.Priority, rec.Target)
+				updater.SetMXRecord(host, rec.Priority, rec.Target)
+			case "SRV":
+				logger.Printf("Updating %s to (SRV) %d %d %d %v", host, rec.Priority, rec.Weight, rec.Port, rec.Target)
+				updater.SetSRVRecord(host, rec.Priority, rec.Weight, rec.Port, rec.Target)
+			default:
+				logger.Printf("Unknown record type %q for host %s, skipping", rec.Type, host)
+				continue
+			}
+		}
+		changed[host] = key
+	}
+
+	// Only remember a host's new value once it's been published
+	// successfully; on error, leave it out of last so the next reconcile
+	// retries it instead of assuming it already went through.
+	err = updater.Wait()
+	if err == nil {
+		for host, key := range changed {
+			last[host] = key
+		}
+	}
+	return err
 }
 
 func main() {
 	var fourFrom, sixFrom, configFile, logFile string
+	var daemon bool
 	flag.StringVar(&fourFrom, "4", "eth0", "pull ipv4 address from")
 	flag.StringVar(&sixFrom, "6", "br0", "pull ipv6 address from")
 	flag.StringVar(&configFile, "config", "dnsup.yml", "config file (yaml)")
 	flag.StringVar(&logFile, "log", "", "log file")
+	flag.BoolVar(&daemon, "daemon", false, "stay resident and periodically reconcile instead of exiting")
 	flag.Parse()
 
 	var logWriter io.WriteCloser = &DevNull{}
@@ -189,67 +317,105 @@ func main() {
 
 	logger := log.New(logWriter, "DNSUp: ", log.LstdFlags)
 
-	config := &Config{}
-	configData, err := ioutil.ReadFile(configFile)
+	config, configData, err := loadConfig(configFile)
 	if err != nil {
 		logger.Fatal("Failed to read config file:", err)
 	}
-	err = yaml.Unmarshal(configData, &config)
+
+	updater, err := buildUpdater(logger, config, configData)
 	if err != nil {
-		logger.Fatal("Failed to parse config file:", err)
+		logger.Fatal("Failed to initialize DNS provider:", err)
 	}
 
-	var four, sixPrefix net.IP
+	isDaemon := daemon || config.Interval != ""
 
-	ifs, err := net.Interfaces()
-	if err != nil {
-		logger.Fatal("Failed to get net interfaces:", err)
+	last := map[string]string{}
+	if err := reconcile(logger, updater, config, fourFrom, sixFrom, last); err != nil {
+		if !isDaemon {
+			logger.Fatal("Reconcile failed:", err)
+		}
+		// In daemon mode a failed startup reconcile shouldn't kill the
+		// long-running agent; fall through to the ticker/backoff loop and
+		// let it retry instead.
+		logger.Print("Initial reconcile failed: ", err)
 	}
-	for _, iface := range ifs {
-		addrs, err := iface.Addrs()
+
+	if !isDaemon {
+		return
+	}
+
+	interval := defaultDaemonInterval
+	if config.Interval != "" {
+		interval, err = time.ParseDuration(config.Interval)
 		if err != nil {
-			continue
-		}
-		if iface.Name == fourFrom {
-			four = chooseFour(chooseUnicast(addrs))
-		}
-		if iface.Name == sixFrom {
-			sixPrefix = chooseSix(chooseUnicast(addrs))
+			logger.Fatal("Invalid interval:", err)
 		}
 	}
 
-	azureAuthSettings := auth.EnvironmentSettings{
-		Values: map[string]string{
-			auth.ClientID:     config.AzureConfig.ClientID,
-			auth.ClientSecret: config.AzureConfig.ClientSecret,
-			auth.TenantID:     config.AzureConfig.TenantID,
-			auth.Resource:     azure.PublicCloud.ResourceManagerEndpoint,
-		},
-		Environment: azure.PublicCloud,
-	}
-	authorizer, err := azureAuthSettings.GetAuthorizer()
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
+
+	addrEvents, closeWatcher, err := newAddressWatcher(logger, fourFrom, sixFrom)
 	if err != nil {
-		log.Fatal("Failed to authenticate to Azure: ", err)
+		logger.Print("Failed to start address watcher, relying on interval polling only: ", err)
+	} else {
+		defer closeWatcher()
 	}
 
-	updater := newAzureDnsUpdater(logger, authorizer, config.AzureConfig.SubscriptionID, config.AzureConfig.ResourceGroup, config.Zone)
+	backoff := interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	for host, ip := range config.Hosts {
-		if ip.Is4() {
-			finalIp := ip.ApplyIPToMask(four)
-			logger.Printf("Updating %s to (IPv4) %v", host, finalIp)
-			updater.SetARecord(host, finalIp)
-		} else {
-			finalIp := ip.ApplyIPToMask(sixPrefix)
-			logger.Printf("Updating %s to (IPv6) %v", host, finalIp)
-			updater.SetAAAARecord(host, finalIp)
+	doReconcile := func() {
+		if err := reconcile(logger, updater, config, fourFrom, sixFrom, last); err != nil {
+			logger.Print("Reconcile failed: ", err)
+			if backoff *= 2; backoff > maxReconcileBackoff {
+				backoff = maxReconcileBackoff
+			}
+			ticker.Reset(backoff)
+		} else if backoff != interval {
+			backoff = interval
+			ticker.Reset(interval)
 		}
 	}
 
-	updater.Wait()
-	if err != nil {
-		//logger.Print(reply)
-		logger.Fatal("Failed to update DNS sever:", err)
-	}
+	for {
+		select {
+		case <-ticker.C:
+			doReconcile()
+
+		case <-addrEvents:
+			doReconcile()
+
+		case <-sighup:
+			logger.Print("Reloading config")
+			newConfig, newConfigData, err := loadConfig(configFile)
+			if err != nil {
+				logger.Print("Failed to reload config: ", err)
+				continue
+			}
+			newUpdater, err := buildUpdater(logger, newConfig, newConfigData)
+			if err != nil {
+				logger.Print("Failed to rebuild DNS provider: ", err)
+				continue
+			}
+			config, updater = newConfig, newUpdater
+			last = map[string]string{}
+			if config.Interval != "" {
+				if newInterval, err := time.ParseDuration(config.Interval); err != nil {
+					logger.Print("Invalid interval, keeping previous: ", err)
+				} else {
+					interval = newInterval
+				}
+			}
+			backoff = interval
+			ticker.Reset(interval)
 
+		case <-sigterm:
+			logger.Print("Shutting down")
+			return
+		}
+	}
 }
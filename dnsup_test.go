@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/DHowett/dnsup/providers"
+)
+
+type fakeUpdater struct{}
+
+func (fakeUpdater) SetARecord(host string, ip net.IP)                                      {}
+func (fakeUpdater) SetAAAARecord(host string, ip net.IP)                                   {}
+func (fakeUpdater) SetCNAMERecord(host string, target string)                              {}
+func (fakeUpdater) SetTXTRecord(host string, values []string)                              {}
+func (fakeUpdater) SetMXRecord(host string, priority uint16, target string)                {}
+func (fakeUpdater) SetSRVRecord(host string, priority, weight, port uint16, target string) {}
+func (fakeUpdater) Wait() error                                                            { return nil }
+
+// TestBuildUpdaterSplitsProviderSection exercises buildUpdater against a
+// config document with scalar top-level keys alongside a provider section,
+// i.e. any realistic dnsup.yml. Decoding the document into
+// map[string]yaml.MapSlice instead of map[string]interface{} fails here with
+// a *yaml.TypeError, since scalars can't unmarshal into a MapSlice.
+func TestBuildUpdaterSplitsProviderSection(t *testing.T) {
+	var gotConfig string
+	providers.Register("buildupdatertest", func(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (providers.DNSUpdater, error) {
+		gotConfig = string(rawConfig)
+		return fakeUpdater{}, nil
+	})
+
+	configData := []byte(`provider: buildupdatertest
+zone: example.com
+ttl: 300
+interval: 5m
+buildupdatertest:
+  tenantId: abc
+hosts:
+  foo: 10.0.0.0/24
+`)
+	config := &Config{Provider: "buildupdatertest", Zone: "example.com"}
+	logger := log.New(ioutil.Discard, "", 0)
+	if _, err := buildUpdater(logger, config, configData); err != nil {
+		t.Fatalf("buildUpdater: %v", err)
+	}
+	if gotConfig == "" {
+		t.Fatal("provider factory never received its config section")
+	}
+}
+
+// TestRecordKeyNilInterfaceAddress covers the case an ApplyIPToMask panic
+// used to reach: the watched interface currently has no address of the
+// record's family (e.g. just lost its lease, or hasn't been configured yet).
+func TestRecordKeyNilInterfaceAddress(t *testing.T) {
+	_, sixCIDR, _ := net.ParseCIDR("2001:db8::/64")
+	rec := &HostRecord{IP: &IP{ip: net.ParseIP("2001:db8::1"), mask: sixCIDR.Mask}}
+
+	if _, ok := recordKey(rec, nil, nil); ok {
+		t.Fatal("expected recordKey to report !ok when the source interface has no address")
+	}
+}
+
+func TestRecordKeyTypedRecords(t *testing.T) {
+	cname := &HostRecord{Type: "CNAME", Target: "target.example.com"}
+	if key, ok := recordKey(cname, nil, nil); !ok || key == "" {
+		t.Fatalf("recordKey(CNAME) = %q, %v", key, ok)
+	}
+
+	txtA := &HostRecord{Type: "TXT", Values: []string{"a", "b"}}
+	txtB := &HostRecord{Type: "TXT", Values: []string{"a", "b"}}
+	keyA, _ := recordKey(txtA, nil, nil)
+	keyB, _ := recordKey(txtB, nil, nil)
+	if keyA != keyB {
+		t.Fatalf("recordKey(TXT) not stable across equal inputs: %q != %q", keyA, keyB)
+	}
+
+	// An unknown type still gets a (stable) key so change detection works;
+	// reconcile's dispatch switch is what actually skips publishing it.
+	if key, ok := recordKey(&HostRecord{Type: "BOGUS"}, nil, nil); !ok || key == "" {
+		t.Fatalf("recordKey(BOGUS) = %q, %v", key, ok)
+	}
+}
@@ -0,0 +1,365 @@
+// Package azure implements the dnsup DNSUpdater interface against Azure DNS.
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Azure/azure-sdk-for-go/profiles/latest/dns/mgmt/dns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"github.com/DHowett/dnsup/providers"
+)
+
+// AuthMethod selects how NewDNSProvider obtains an Azure authorizer.
+type AuthMethod string
+
+const (
+	// AuthServicePrincipal authenticates with ClientID/ClientSecret/TenantID
+	// (the default, and the only method this provider originally supported).
+	AuthServicePrincipal AuthMethod = "servicePrincipal"
+	// AuthManagedIdentity authenticates via the Instance Metadata Service,
+	// for dnsup instances running on an Azure VM.
+	AuthManagedIdentity AuthMethod = "managedIdentity"
+	// AuthCLI reuses the credentials of an `az login` session.
+	AuthCLI AuthMethod = "cli"
+	// AuthEnvironment reads AZURE_* variables from the process environment,
+	// as consumed by auth.NewAuthorizerFromEnvironment.
+	AuthEnvironment AuthMethod = "env"
+)
+
+// Config holds the `azure:` section of the dnsup config file.
+type Config struct {
+	AuthMethod       AuthMethod `yaml:"authMethod"`
+	ClientID         string     `yaml:"clientId"`
+	ClientSecret     string     `yaml:"clientSecret"`
+	TenantID         string     `yaml:"tenantId"`
+	SubscriptionID   string     `yaml:"subscriptionId"`
+	ResourceGroup    string     `yaml:"resourceGroup"`
+	Environment      string     `yaml:"environment"`
+	MetadataEndpoint string     `yaml:"metadataEndpoint"`
+	MaxConcurrency   int        `yaml:"maxConcurrency"`
+	RetryAttempts    int        `yaml:"retryAttempts"`
+}
+
+const (
+	defaultTTL            = 300
+	defaultMaxConcurrency = 4
+)
+
+// recordKey identifies a RecordSet: one per (host, record type) pair. Every
+// SetARecord/SetAAAARecord call queued under the same key is coalesced into
+// a single RecordSet with multiple A/AAAA entries before publishing, rather
+// than racing separate CreateOrUpdate calls against the same record.
+type recordKey struct {
+	host       string
+	recordType dns.RecordType
+}
+
+type mxEntry struct {
+	priority uint16
+	target   string
+}
+
+type srvEntry struct {
+	priority, weight, port uint16
+	target                 string
+}
+
+type dnsUpdater struct {
+	logger         *log.Logger
+	dnsClient      dns.RecordSetsClient
+	resourceGroup  string
+	zone           string
+	ttl            int64
+	maxConcurrency int
+
+	mu           sync.Mutex
+	pending      map[recordKey][]string
+	pendingCNAME map[string]string
+	pendingTXT   map[string][]string
+	pendingMX    map[string][]mxEntry
+	pendingSRV   map[string][]srvEntry
+}
+
+func (a *dnsUpdater) queue(host string, recordType dns.RecordType, ip net.IP) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := recordKey{host: host, recordType: recordType}
+	a.pending[key] = append(a.pending[key], ip.String())
+}
+
+func (a *dnsUpdater) SetARecord(host string, ip net.IP) {
+	a.queue(host, dns.A, ip)
+}
+
+func (a *dnsUpdater) SetAAAARecord(host string, ip net.IP) {
+	a.queue(host, dns.AAAA, ip)
+}
+
+func (a *dnsUpdater) SetCNAMERecord(host string, target string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pendingCNAME[host] = target
+}
+
+func (a *dnsUpdater) SetTXTRecord(host string, values []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pendingTXT[host] = values
+}
+
+func (a *dnsUpdater) SetMXRecord(host string, priority uint16, target string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pendingMX[host] = append(a.pendingMX[host], mxEntry{priority: priority, target: target})
+}
+
+func (a *dnsUpdater) SetSRVRecord(host string, priority, weight, port uint16, target string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pendingSRV[host] = append(a.pendingSRV[host], srvEntry{priority: priority, weight: weight, port: port, target: target})
+}
+
+func (a *dnsUpdater) publish(host string, recordType dns.RecordType, props *dns.RecordSetProperties) error {
+	props.TTL = to.Int64Ptr(a.ttl)
+	_, err := a.dnsClient.CreateOrUpdate(context.Background(), a.resourceGroup, a.zone, host, recordType, dns.RecordSet{
+		RecordSetProperties: props,
+	}, "", "")
+	if err != nil {
+		return fmt.Errorf("updating %s (%s): %w", host, recordType, err)
+	}
+	return nil
+}
+
+// Wait flushes every record queued since the last Wait through a worker pool
+// bounded by maxConcurrency, and returns the aggregate of any errors
+// encountered. The Azure ARM API is rate-limited, so transient 429/5xx
+// responses are retried with backoff by dnsClient's autorest retry sender
+// before they ever reach here.
+func (a *dnsUpdater) Wait() error {
+	a.mu.Lock()
+	aRecords, cnames, txts, mxs, srvs := a.pending, a.pendingCNAME, a.pendingTXT, a.pendingMX, a.pendingSRV
+	a.pending = map[recordKey][]string{}
+	a.pendingCNAME = map[string]string{}
+	a.pendingTXT = map[string][]string{}
+	a.pendingMX = map[string][]mxEntry{}
+	a.pendingSRV = map[string][]srvEntry{}
+	a.mu.Unlock()
+
+	var jobs []func() error
+
+	for key, ips := range aRecords {
+		key, ips := key, ips
+		jobs = append(jobs, func() error {
+			props := &dns.RecordSetProperties{}
+			switch key.recordType {
+			case dns.A:
+				records := make([]dns.ARecord, len(ips))
+				for i, ip := range ips {
+					records[i] = dns.ARecord{Ipv4Address: to.StringPtr(ip)}
+				}
+				props.ARecords = &records
+			case dns.AAAA:
+				records := make([]dns.AaaaRecord, len(ips))
+				for i, ip := range ips {
+					records[i] = dns.AaaaRecord{Ipv6Address: to.StringPtr(ip)}
+				}
+				props.AaaaRecords = &records
+			}
+			return a.publish(key.host, key.recordType, props)
+		})
+	}
+	for host, target := range cnames {
+		host, target := host, target
+		jobs = append(jobs, func() error {
+			props := &dns.RecordSetProperties{CnameRecord: &dns.CnameRecord{Cname: to.StringPtr(target)}}
+			return a.publish(host, dns.CNAME, props)
+		})
+	}
+	for host, values := range txts {
+		host, values := host, values
+		jobs = append(jobs, func() error {
+			// One dns.TxtRecord per configured value, matching route53 and
+			// gcp: otherwise independent values (e.g. SPF + a verification
+			// token) would be merged into a single record's character-strings.
+			records := make([]dns.TxtRecord, len(values))
+			for i, v := range values {
+				records[i] = dns.TxtRecord{Value: &[]string{v}}
+			}
+			props := &dns.RecordSetProperties{TxtRecords: &records}
+			return a.publish(host, dns.TXT, props)
+		})
+	}
+	for host, entries := range mxs {
+		host, entries := host, entries
+		jobs = append(jobs, func() error {
+			records := make([]dns.MxRecord, len(entries))
+			for i, e := range entries {
+				records[i] = dns.MxRecord{Preference: to.Int32Ptr(int32(e.priority)), Exchange: to.StringPtr(e.target)}
+			}
+			props := &dns.RecordSetProperties{MxRecords: &records}
+			return a.publish(host, dns.MX, props)
+		})
+	}
+	for host, entries := range srvs {
+		host, entries := host, entries
+		jobs = append(jobs, func() error {
+			records := make([]dns.SrvRecord, len(entries))
+			for i, e := range entries {
+				records[i] = dns.SrvRecord{
+					Priority: to.Int32Ptr(int32(e.priority)),
+					Weight:   to.Int32Ptr(int32(e.weight)),
+					Port:     to.Int32Ptr(int32(e.port)),
+					Target:   to.StringPtr(e.target),
+				}
+			}
+			props := &dns.RecordSetProperties{SrvRecords: &records}
+			return a.publish(host, dns.SRV, props)
+		})
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, a.maxConcurrency)
+	errs := make(chan error, len(jobs))
+
+	for _, job := range jobs {
+		job := job
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := job(); err != nil {
+				a.logger.Print("Error: ", err)
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	collected := make([]error, 0, len(errs))
+	for err := range errs {
+		collected = append(collected, err)
+	}
+	return providers.JoinErrors(collected...)
+}
+
+func newDNSUpdater(logger *log.Logger, authorizer autorest.Authorizer, subscription string, resourceGroup string, zone string, ttl int64, maxConcurrency int, retryAttempts int) *dnsUpdater {
+	dnsClient := dns.NewRecordSetsClient(subscription)
+	dnsClient.Authorizer = authorizer
+	if retryAttempts > 0 {
+		dnsClient.RetryAttempts = retryAttempts
+	}
+	return &dnsUpdater{
+		logger:         logger,
+		dnsClient:      dnsClient,
+		resourceGroup:  resourceGroup,
+		zone:           zone,
+		ttl:            ttl,
+		maxConcurrency: maxConcurrency,
+		pending:        map[recordKey][]string{},
+		pendingCNAME:   map[string]string{},
+		pendingTXT:     map[string][]string{},
+		pendingMX:      map[string][]mxEntry{},
+		pendingSRV:     map[string][]srvEntry{},
+	}
+}
+
+// resolveEnvironment returns the Azure environment to authenticate against,
+// honoring the `environment:` config key and falling back to the
+// AZURE_ENVIRONMENT variable lego and the Azure SDK itself recognize
+// (e.g. AzureChinaCloud, AzureUSGovernmentCloud), defaulting to public.
+func resolveEnvironment(name string) (azure.Environment, error) {
+	if name == "" {
+		name = os.Getenv("AZURE_ENVIRONMENT")
+	}
+	if name == "" {
+		return azure.PublicCloud, nil
+	}
+	return azure.EnvironmentFromName(name)
+}
+
+func newAuthorizer(cfg *Config, env azure.Environment) (autorest.Authorizer, error) {
+	switch cfg.AuthMethod {
+	case AuthManagedIdentity:
+		endpoint := cfg.MetadataEndpoint
+		if endpoint == "" {
+			var err error
+			endpoint, err = adal.GetMSIVMEndpoint()
+			if err != nil {
+				return nil, err
+			}
+		}
+		spt, err := adal.NewServicePrincipalTokenFromMSI(endpoint, env.ResourceManagerEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("acquiring MSI token: %w", err)
+		}
+		return autorest.NewBearerAuthorizer(spt), nil
+
+	case AuthCLI:
+		return auth.NewAuthorizerFromCLIWithResource(env.ResourceManagerEndpoint)
+
+	case AuthEnvironment:
+		return auth.NewAuthorizerFromEnvironment()
+
+	case AuthServicePrincipal, "":
+		authSettings := auth.EnvironmentSettings{
+			Values: map[string]string{
+				auth.ClientID:     cfg.ClientID,
+				auth.ClientSecret: cfg.ClientSecret,
+				auth.TenantID:     cfg.TenantID,
+				auth.Resource:     env.ResourceManagerEndpoint,
+			},
+			Environment: env,
+		}
+		return authSettings.GetAuthorizer()
+
+	default:
+		return nil, fmt.Errorf("unknown azure authMethod %q", cfg.AuthMethod)
+	}
+}
+
+// NewDNSProvider builds an Azure DNS updater from its YAML config section.
+func NewDNSProvider(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (providers.DNSUpdater, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(rawConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	env, err := resolveEnvironment(cfg.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizer, err := newAuthorizer(cfg, env)
+	if err != nil {
+		return nil, err
+	}
+
+	recordTTL := int64(ttl)
+	if recordTTL == 0 {
+		recordTTL = defaultTTL
+	}
+	maxConcurrency := cfg.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultMaxConcurrency
+	}
+
+	return newDNSUpdater(logger, authorizer, cfg.SubscriptionID, cfg.ResourceGroup, zone, recordTTL, maxConcurrency, cfg.RetryAttempts), nil
+}
+
+func init() {
+	providers.Register("azure", NewDNSProvider)
+}
@@ -0,0 +1,204 @@
+// Package cloudflare implements the dnsup DNSUpdater interface against
+// Cloudflare DNS.
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	cf "github.com/cloudflare/cloudflare-go"
+
+	"github.com/DHowett/dnsup/providers"
+)
+
+const defaultTTL = 300
+
+// Config holds the `cloudflare:` section of the dnsup config file.
+type Config struct {
+	APIToken string `yaml:"apiToken"`
+	APIKey   string `yaml:"apiKey"`
+	APIEmail string `yaml:"apiEmail"`
+	ZoneID   string `yaml:"zoneId"`
+}
+
+type dnsUpdater struct {
+	logger *log.Logger
+	api    *cf.API
+	zoneID string
+	zone   string
+	ttl    int
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func (u *dnsUpdater) recordErr(host string, err error) {
+	u.logger.Print("Error updating ", host, ": ", err)
+	u.mu.Lock()
+	u.errs = append(u.errs, err)
+	u.mu.Unlock()
+}
+
+// recordValue is one record's worth of Cloudflare-specific payload. Content
+// is used by every type except SRV (and LOC, which dnsup doesn't support),
+// which Cloudflare requires structured through Data instead.
+type recordValue struct {
+	content string
+	data    interface{}
+}
+
+// setRecords reconciles every existing record of recordType at host against
+// values: the first len(existing) values update those records in place,
+// any extra values create new records, and any existing records beyond
+// len(values) are deleted. This keeps multi-value types (TXT) as one
+// Cloudflare record per value instead of merging them, and cleans up
+// leftovers if a host's value count shrinks between reconciles.
+func (u *dnsUpdater) setRecords(host string, recordType string, values []recordValue, priority *uint16) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		name := fmt.Sprintf("%s.%s", host, u.zone)
+		ctx := context.Background()
+		existing, _, err := u.api.ListDNSRecords(ctx, cf.ZoneIdentifier(u.zoneID), cf.ListDNSRecordsParams{
+			Type: recordType,
+			Name: name,
+		})
+		if err != nil {
+			u.recordErr(host, fmt.Errorf("looking up %s: %w", host, err))
+			return
+		}
+
+		for i, v := range values {
+			if i < len(existing) {
+				_, err = u.api.UpdateDNSRecord(ctx, cf.ZoneIdentifier(u.zoneID), cf.UpdateDNSRecordParams{
+					ID:       existing[i].ID,
+					Type:     recordType,
+					Name:     name,
+					Content:  v.content,
+					Data:     v.data,
+					TTL:      u.ttl,
+					Priority: priority,
+				})
+			} else {
+				_, err = u.api.CreateDNSRecord(ctx, cf.ZoneIdentifier(u.zoneID), cf.CreateDNSRecordParams{
+					Type:     recordType,
+					Name:     name,
+					Content:  v.content,
+					Data:     v.data,
+					TTL:      u.ttl,
+					Priority: priority,
+				})
+			}
+			if err != nil {
+				u.recordErr(host, fmt.Errorf("updating %s: %w", host, err))
+			}
+		}
+
+		keep := len(values)
+		if keep > len(existing) {
+			keep = len(existing)
+		}
+		for _, stale := range existing[keep:] {
+			if err := u.api.DeleteDNSRecord(ctx, cf.ZoneIdentifier(u.zoneID), stale.ID); err != nil {
+				u.recordErr(host, fmt.Errorf("removing stale record for %s: %w", host, err))
+			}
+		}
+	}()
+}
+
+func (u *dnsUpdater) SetARecord(host string, ip net.IP) {
+	u.setRecords(host, "A", []recordValue{{content: ip.String()}}, nil)
+}
+
+func (u *dnsUpdater) SetAAAARecord(host string, ip net.IP) {
+	u.setRecords(host, "AAAA", []recordValue{{content: ip.String()}}, nil)
+}
+
+func (u *dnsUpdater) SetCNAMERecord(host string, target string) {
+	u.setRecords(host, "CNAME", []recordValue{{content: target}}, nil)
+}
+
+func (u *dnsUpdater) SetTXTRecord(host string, values []string) {
+	// Cloudflare TXT records are separate records, not multiple strings
+	// packed into one record's content, so each value gets its own record.
+	recordValues := make([]recordValue, len(values))
+	for i, v := range values {
+		recordValues[i] = recordValue{content: v}
+	}
+	u.setRecords(host, "TXT", recordValues, nil)
+}
+
+func (u *dnsUpdater) SetMXRecord(host string, priority uint16, target string) {
+	u.setRecords(host, "MX", []recordValue{{content: target}}, &priority)
+}
+
+func (u *dnsUpdater) SetSRVRecord(host string, priority, weight, port uint16, target string) {
+	// Cloudflare models SRV through the structured Data field rather than
+	// Content.
+	data := map[string]interface{}{
+		"priority": priority,
+		"weight":   weight,
+		"port":     port,
+		"target":   target,
+	}
+	u.setRecords(host, "SRV", []recordValue{{data: data}}, nil)
+}
+
+func (u *dnsUpdater) Wait() error {
+	u.wg.Wait()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	err := providers.JoinErrors(u.errs...)
+	u.errs = nil
+	return err
+}
+
+// NewDNSProvider builds a Cloudflare DNS updater from its YAML config section.
+func NewDNSProvider(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (providers.DNSUpdater, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(rawConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	var api *cf.API
+	var err error
+	if cfg.APIToken != "" {
+		api, err = cf.NewWithAPIToken(cfg.APIToken)
+	} else {
+		api, err = cf.New(cfg.APIKey, cfg.APIEmail)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zoneID := cfg.ZoneID
+	if zoneID == "" {
+		zoneID, err = api.ZoneIDByName(zone)
+		if err != nil {
+			return nil, fmt.Errorf("looking up zone %q: %w", zone, err)
+		}
+	}
+
+	recordTTL := int(ttl)
+	if recordTTL == 0 {
+		recordTTL = defaultTTL
+	}
+
+	return &dnsUpdater{
+		logger: logger,
+		api:    api,
+		zoneID: zoneID,
+		zone:   zone,
+		ttl:    recordTTL,
+	}, nil
+}
+
+func init() {
+	providers.Register("cloudflare", NewDNSProvider)
+}
@@ -0,0 +1,183 @@
+// Package gcp implements the dnsup DNSUpdater interface against Google
+// Cloud DNS.
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"google.golang.org/api/dns/v1"
+	"google.golang.org/api/option"
+
+	"github.com/DHowett/dnsup/providers"
+)
+
+const defaultTTL = 300
+
+// Config holds the `gcp:` section of the dnsup config file.
+type Config struct {
+	ProjectID       string `yaml:"projectId"`
+	ManagedZone     string `yaml:"managedZone"`
+	CredentialsFile string `yaml:"credentialsFile"`
+}
+
+type dnsUpdater struct {
+	logger      *log.Logger
+	svc         *dns.Service
+	projectID   string
+	managedZone string
+	zone        string
+	ttl         int64
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// rrdatasEqual reports whether a and b contain the same rrdata values,
+// ignoring order (Google Cloud DNS doesn't guarantee Rrdatas ordering is
+// preserved across reads).
+func rrdatasEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setRecord upserts a RecordSet of recordType with rrdatas verbatim; Google
+// Cloud DNS's Rrdatas is already a multi-value, zone-file-style string list,
+// so TXT/MX/SRV all flow through the same path as A/AAAA.
+func (u *dnsUpdater) setRecord(host string, recordType string, rrdatas []string) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		name := fmt.Sprintf("%s.%s", host, u.zone)
+		ctx := context.Background()
+
+		change := &dns.Change{
+			Additions: []*dns.ResourceRecordSet{
+				{
+					Name:    name,
+					Type:    recordType,
+					Ttl:     u.ttl,
+					Rrdatas: rrdatas,
+				},
+			},
+		}
+
+		existing, err := u.svc.ResourceRecordSets.List(u.projectID, u.managedZone).Name(name).Type(recordType).Do()
+		if err != nil {
+			u.logger.Print("Error looking up ", host, ": ", err)
+			u.mu.Lock()
+			u.errs = append(u.errs, fmt.Errorf("looking up %s: %w", host, err))
+			u.mu.Unlock()
+			return
+		}
+
+		// A no-op delete+add of the identical RecordSet is rejected by the
+		// Changes API, which reconcile's cron-mode republish-every-run
+		// behavior would trigger on every steady-state run. Skip the
+		// Change entirely when nothing would actually change.
+		if len(existing.Rrsets) == 1 && existing.Rrsets[0].Ttl == u.ttl && rrdatasEqual(existing.Rrsets[0].Rrdatas, rrdatas) {
+			return
+		}
+		change.Deletions = existing.Rrsets
+
+		_, err = u.svc.Changes.Create(u.projectID, u.managedZone, change).Context(ctx).Do()
+		if err != nil {
+			u.logger.Print("Error updating ", host, ": ", err)
+			u.mu.Lock()
+			u.errs = append(u.errs, fmt.Errorf("updating %s: %w", host, err))
+			u.mu.Unlock()
+		}
+	}()
+}
+
+func (u *dnsUpdater) SetARecord(host string, ip net.IP) {
+	u.setRecord(host, "A", []string{ip.String()})
+}
+
+func (u *dnsUpdater) SetAAAARecord(host string, ip net.IP) {
+	u.setRecord(host, "AAAA", []string{ip.String()})
+}
+
+func (u *dnsUpdater) SetCNAMERecord(host string, target string) {
+	u.setRecord(host, "CNAME", []string{target})
+}
+
+func (u *dnsUpdater) SetTXTRecord(host string, values []string) {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	u.setRecord(host, "TXT", quoted)
+}
+
+func (u *dnsUpdater) SetMXRecord(host string, priority uint16, target string) {
+	u.setRecord(host, "MX", []string{fmt.Sprintf("%d %s", priority, target)})
+}
+
+func (u *dnsUpdater) SetSRVRecord(host string, priority, weight, port uint16, target string) {
+	u.setRecord(host, "SRV", []string{fmt.Sprintf("%d %d %d %s", priority, weight, port, target)})
+}
+
+func (u *dnsUpdater) Wait() error {
+	u.wg.Wait()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	err := providers.JoinErrors(u.errs...)
+	u.errs = nil
+	return err
+}
+
+// NewDNSProvider builds a Google Cloud DNS updater from its YAML config section.
+func NewDNSProvider(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (providers.DNSUpdater, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(rawConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	svc, err := dns.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	recordTTL := int64(ttl)
+	if recordTTL == 0 {
+		recordTTL = defaultTTL
+	}
+
+	return &dnsUpdater{
+		logger:      logger,
+		svc:         svc,
+		projectID:   cfg.ProjectID,
+		managedZone: cfg.ManagedZone,
+		zone:        zone,
+		ttl:         recordTTL,
+	}, nil
+}
+
+func init() {
+	providers.Register("gcp", NewDNSProvider)
+}
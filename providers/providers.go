@@ -0,0 +1,70 @@
+// Package providers defines the interface dnsup backends implement and a
+// registry providers use to make themselves selectable via the `provider:`
+// config key.
+package providers
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+// DNSUpdater publishes DNS records to a backend. Implementations are
+// expected to perform updates asynchronously and report completion, along
+// with any errors encountered, from Wait.
+type DNSUpdater interface {
+	SetARecord(host string, ip net.IP)
+	SetAAAARecord(host string, ip net.IP)
+	SetCNAMERecord(host string, target string)
+	SetTXTRecord(host string, values []string)
+	SetMXRecord(host string, priority uint16, target string)
+	SetSRVRecord(host string, priority, weight, port uint16, target string)
+	Wait() error
+}
+
+// Factory builds a DNSUpdater from a provider's own YAML configuration
+// section (rawConfig), the zone it will publish records into, and the
+// record TTL (in seconds) configured by the `ttl:` key.
+type Factory func(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (DNSUpdater, error)
+
+var registry = map[string]Factory{}
+
+// Register makes a provider available under name. Providers call this from
+// an init function so that importing a provider package for side effects
+// (see the blank imports in main) is enough to make it selectable.
+func Register(name string, factory Factory) {
+	registry[name] = factory
+}
+
+// Get looks up a provider factory previously registered under name.
+func Get(name string) (Factory, bool) {
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+// multiError aggregates the errors from a batch of concurrent record
+// updates into a single error.
+type multiError []error
+
+func (m multiError) Error() string {
+	strs := make([]string, len(m))
+	for i, err := range m {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "; ")
+}
+
+// JoinErrors combines the non-nil errors from a Wait() pass into a single
+// error, or returns nil if none of them are non-nil.
+func JoinErrors(errs ...error) error {
+	var nonNil multiError
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	if len(nonNil) == 0 {
+		return nil
+	}
+	return nonNil
+}
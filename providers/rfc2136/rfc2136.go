@@ -0,0 +1,156 @@
+// Package rfc2136 implements the dnsup DNSUpdater interface against any
+// nameserver that supports RFC 2136 dynamic updates (e.g. BIND, Knot).
+package rfc2136
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/miekg/dns"
+
+	"github.com/DHowett/dnsup/providers"
+)
+
+const defaultTTL = 300
+
+// Config holds the `rfc2136:` section of the dnsup config file.
+type Config struct {
+	Nameserver    string `yaml:"nameserver"`
+	TSIGKey       string `yaml:"tsigKey"`
+	TSIGSecret    string `yaml:"tsigSecret"`
+	TSIGAlgorithm string `yaml:"tsigAlgorithm"`
+}
+
+type dnsUpdater struct {
+	logger     *log.Logger
+	client     *dns.Client
+	nameserver string
+	zone       string
+	tsigKey    string
+	tsigAlgo   string
+	ttl        uint32
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// setRecord replaces the RRset of rrType at host with a single RR built from
+// rdata, which must already be in zone-file rdata syntax for rrType (e.g. a
+// quoted string for TXT, "priority target" for MX).
+func (u *dnsUpdater) setRecord(host string, rrType uint16, rdata string) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		fqdn := dns.Fqdn(fmt.Sprintf("%s.%s", host, u.zone))
+
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", fqdn, u.ttl, dns.TypeToString[rrType], rdata))
+		if err != nil {
+			u.logger.Print("Error building record for ", host, ": ", err)
+			u.mu.Lock()
+			u.errs = append(u.errs, fmt.Errorf("building record for %s: %w", host, err))
+			u.mu.Unlock()
+			return
+		}
+
+		m := new(dns.Msg)
+		m.SetUpdate(dns.Fqdn(u.zone))
+		m.RemoveRRset([]dns.RR{rr})
+		m.Insert([]dns.RR{rr})
+		if u.tsigKey != "" {
+			m.SetTsig(u.tsigKey, u.tsigAlgo, 300, time.Now().Unix())
+		}
+
+		_, _, err = u.client.Exchange(m, u.nameserver)
+		if err != nil {
+			u.logger.Print("Error updating ", host, ": ", err)
+			u.mu.Lock()
+			u.errs = append(u.errs, fmt.Errorf("updating %s: %w", host, err))
+			u.mu.Unlock()
+		}
+	}()
+}
+
+func (u *dnsUpdater) SetARecord(host string, ip net.IP) {
+	u.setRecord(host, dns.TypeA, ip.String())
+}
+
+func (u *dnsUpdater) SetAAAARecord(host string, ip net.IP) {
+	u.setRecord(host, dns.TypeAAAA, ip.String())
+}
+
+func (u *dnsUpdater) SetCNAMERecord(host string, target string) {
+	u.setRecord(host, dns.TypeCNAME, dns.Fqdn(target))
+}
+
+func (u *dnsUpdater) SetTXTRecord(host string, values []string) {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	u.setRecord(host, dns.TypeTXT, strings.Join(quoted, " "))
+}
+
+func (u *dnsUpdater) SetMXRecord(host string, priority uint16, target string) {
+	u.setRecord(host, dns.TypeMX, fmt.Sprintf("%d %s", priority, dns.Fqdn(target)))
+}
+
+func (u *dnsUpdater) SetSRVRecord(host string, priority, weight, port uint16, target string) {
+	u.setRecord(host, dns.TypeSRV, fmt.Sprintf("%d %d %d %s", priority, weight, port, dns.Fqdn(target)))
+}
+
+func (u *dnsUpdater) Wait() error {
+	u.wg.Wait()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	err := providers.JoinErrors(u.errs...)
+	u.errs = nil
+	return err
+}
+
+// NewDNSProvider builds an RFC 2136 dynamic update DNS updater from its
+// YAML config section.
+func NewDNSProvider(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (providers.DNSUpdater, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(rawConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	client := new(dns.Client)
+	var tsigKey string
+	tsigAlgo := dns.HmacSHA256
+	if cfg.TSIGAlgorithm != "" {
+		tsigAlgo = dns.Fqdn(cfg.TSIGAlgorithm)
+	}
+	if cfg.TSIGKey != "" {
+		tsigKey = dns.Fqdn(cfg.TSIGKey)
+		// The key name used here must match the one passed to SetTsig
+		// exactly, or the signer fails the lookup with ErrSecret.
+		client.TsigSecret = map[string]string{tsigKey: cfg.TSIGSecret}
+	}
+
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+
+	return &dnsUpdater{
+		logger:     logger,
+		client:     client,
+		nameserver: cfg.Nameserver,
+		zone:       zone,
+		tsigKey:    tsigKey,
+		tsigAlgo:   tsigAlgo,
+		ttl:        ttl,
+	}, nil
+}
+
+func init() {
+	providers.Register("rfc2136", NewDNSProvider)
+}
@@ -0,0 +1,145 @@
+// Package route53 implements the dnsup DNSUpdater interface against AWS
+// Route 53.
+package route53
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+
+	"github.com/DHowett/dnsup/providers"
+)
+
+const defaultTTL = 300
+
+// Config holds the `route53:` section of the dnsup config file.
+type Config struct {
+	HostedZoneID string `yaml:"hostedZoneId"`
+	Region       string `yaml:"region"`
+}
+
+type dnsUpdater struct {
+	logger       *log.Logger
+	client       *route53.Route53
+	hostedZoneID string
+	zone         string
+	ttl          int64
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// setRecord upserts a RecordSet of recordType with one ResourceRecord per
+// entry in values (multi-value is how Route 53 represents e.g. several
+// TXT strings on the same name).
+func (u *dnsUpdater) setRecord(host string, recordType string, values []string) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		name := fmt.Sprintf("%s.%s", host, u.zone)
+		resourceRecords := make([]*route53.ResourceRecord, len(values))
+		for i, v := range values {
+			resourceRecords[i] = &route53.ResourceRecord{Value: aws.String(v)}
+		}
+		_, err := u.client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(u.hostedZoneID),
+			ChangeBatch: &route53.ChangeBatch{
+				Changes: []*route53.Change{
+					{
+						Action: aws.String(route53.ChangeActionUpsert),
+						ResourceRecordSet: &route53.ResourceRecordSet{
+							Name:            aws.String(name),
+							Type:            aws.String(recordType),
+							TTL:             aws.Int64(u.ttl),
+							ResourceRecords: resourceRecords,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			u.logger.Print("Error updating ", host, ": ", err)
+			u.mu.Lock()
+			u.errs = append(u.errs, fmt.Errorf("updating %s: %w", host, err))
+			u.mu.Unlock()
+		}
+	}()
+}
+
+func (u *dnsUpdater) SetARecord(host string, ip net.IP) {
+	u.setRecord(host, route53.RRTypeA, []string{ip.String()})
+}
+
+func (u *dnsUpdater) SetAAAARecord(host string, ip net.IP) {
+	u.setRecord(host, route53.RRTypeAaaa, []string{ip.String()})
+}
+
+func (u *dnsUpdater) SetCNAMERecord(host string, target string) {
+	u.setRecord(host, route53.RRTypeCname, []string{target})
+}
+
+func (u *dnsUpdater) SetTXTRecord(host string, values []string) {
+	// Each ResourceRecord value for a TXT RecordSet must itself be a
+	// quoted DNS character-string, same as in a zone file.
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	u.setRecord(host, route53.RRTypeTxt, quoted)
+}
+
+func (u *dnsUpdater) SetMXRecord(host string, priority uint16, target string) {
+	u.setRecord(host, route53.RRTypeMx, []string{fmt.Sprintf("%d %s", priority, target)})
+}
+
+func (u *dnsUpdater) SetSRVRecord(host string, priority, weight, port uint16, target string) {
+	u.setRecord(host, route53.RRTypeSrv, []string{fmt.Sprintf("%d %d %d %s", priority, weight, port, target)})
+}
+
+func (u *dnsUpdater) Wait() error {
+	u.wg.Wait()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	err := providers.JoinErrors(u.errs...)
+	u.errs = nil
+	return err
+}
+
+// NewDNSProvider builds a Route 53 DNS updater from its YAML config section.
+func NewDNSProvider(logger *log.Logger, zone string, ttl uint32, rawConfig []byte) (providers.DNSUpdater, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(rawConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(cfg.Region)})
+	if err != nil {
+		return nil, err
+	}
+
+	recordTTL := int64(ttl)
+	if recordTTL == 0 {
+		recordTTL = defaultTTL
+	}
+
+	return &dnsUpdater{
+		logger:       logger,
+		client:       route53.New(sess),
+		hostedZoneID: cfg.HostedZoneID,
+		zone:         zone,
+		ttl:          recordTTL,
+	}, nil
+}
+
+func init() {
+	providers.Register("route53", NewDNSProvider)
+}
@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"log"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// newAddressWatcher returns a channel that receives a value whenever the
+// address of fourFrom or sixFrom changes. It uses netlink address
+// notifications (RTMGRP_IPV4_IFADDR / RTMGRP_IPV6_IFADDR) so changes -
+// including an ISP rotating a delegated IPv6 prefix - are picked up as soon
+// as the kernel sees them, instead of waiting for the next poll.
+func newAddressWatcher(logger *log.Logger, fourFrom, sixFrom string) (<-chan struct{}, func(), error) {
+	updates := make(chan netlink.AddrUpdate)
+	done := make(chan struct{})
+	if err := netlink.AddrSubscribe(updates, done); err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		for update := range updates {
+			iface, err := net.InterfaceByIndex(update.LinkIndex)
+			if err != nil {
+				continue
+			}
+			if iface.Name != fourFrom && iface.Name != sixFrom {
+				continue
+			}
+
+			logger.Printf("Address change on %s: %v (new=%v)", iface.Name, update.LinkAddress.String(), update.NewAddr)
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return events, func() { close(done) }, nil
+}
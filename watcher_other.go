@@ -0,0 +1,41 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// addressPollInterval is how often non-Linux platforms, which have no
+// netlink equivalent wired up, signal the caller to re-read the watched
+// interfaces.
+const addressPollInterval = 30 * time.Second
+
+// newAddressWatcher sends an event every addressPollInterval, standing in for
+// the netlink-driven watcher used on Linux. It does not inspect fourFrom or
+// sixFrom itself: every tick is signalled, whether or not an address changed,
+// and the caller's reconcile re-reads the interfaces.
+func newAddressWatcher(logger *log.Logger, fourFrom, sixFrom string) (<-chan struct{}, func(), error) {
+	events := make(chan struct{}, 1)
+	done := make(chan struct{})
+	ticker := time.NewTicker(addressPollInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return events, func() { close(done) }, nil
+}